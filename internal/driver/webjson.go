@@ -3,7 +3,11 @@ package driver
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"html"
 	"net/http"
+	"os/exec"
 	"strings"
 
 	"github.com/google/pprof/internal/graph"
@@ -29,7 +33,310 @@ func (ui *webInterface) topData(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// sandwichData is the tagged union returned for ?view=sandwich.
+type sandwichData struct {
+	Mode    string    `json:"mode"`
+	Focus   string    `json:"focus"`
+	Callers *treeNode `json:"callers"`
+	Callees *treeNode `json:"callees"`
+}
+
 func (ui *webInterface) flamegraphData(w http.ResponseWriter, req *http.Request) {
+	view := req.URL.Query().Get("view")
+	if view == "sandwich" {
+		ui.flamegraphSandwichData(w, req)
+		return
+	}
+
+	rootNode, config, ok := ui.buildFlameGraphTree(w, req, view)
+	if !ok {
+		return // error already reported
+	}
+
+	switch format := req.URL.Query().Get("format"); format {
+	case "", "json":
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if req.URL.Query().Get("stream") == "1" {
+			writeFlameGraphStream(w, rootNode)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(rootNode); err != nil {
+			http.Error(w, "error serializing flame graph", http.StatusInternalServerError)
+			ui.options.UI.PrintErr(err)
+		}
+	case "ndjson":
+		w.Header().Add("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+		writeFlameGraphNDJSON(w, rootNode)
+	case "svg":
+		writeFlameGraphSVG(w, rootNode, config, false)
+	case "html":
+		writeFlameGraphSVG(w, rootNode, config, true)
+	default:
+		http.Error(w, "unknown flame graph format: "+format, http.StatusBadRequest)
+	}
+}
+
+// writeFlameGraphStream writes root as JSON via a depth-first walk,
+// encoding each node as it is visited and flushing once its subtree is closed.
+func writeFlameGraphStream(w http.ResponseWriter, root *treeNode) {
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	var write func(n *treeNode)
+	write = func(n *treeNode) {
+		fmt.Fprintf(w, `{"n":`)
+		enc.Encode(n.Name)
+		fmt.Fprintf(w, `,"f":`)
+		enc.Encode(n.FullName)
+		fmt.Fprintf(w, `,"v":%d,"l":`, n.Cum)
+		enc.Encode(n.CumFormat)
+		fmt.Fprintf(w, `,"p":`)
+		enc.Encode(n.Percent)
+		w.Write([]byte(`,"c":[`))
+		for i, c := range n.Children {
+			if i > 0 {
+				w.Write([]byte(","))
+			}
+			write(c)
+		}
+		w.Write([]byte("]}"))
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	write(root)
+}
+
+// writeFlameGraphNDJSON emits one JSON object per line, each carrying an
+// "id" and a "parent" id so the tree can be reassembled client-side.
+func writeFlameGraphNDJSON(w http.ResponseWriter, root *treeNode) {
+	flusher, _ := w.(http.Flusher)
+	type ndjsonNode struct {
+		ID       int    `json:"id"`
+		Parent   int    `json:"parent"`
+		Name     string `json:"n"`
+		FullName string `json:"f"`
+		Cum      int64  `json:"v"`
+		CumFmt   string `json:"l"`
+		Percent  string `json:"p"`
+	}
+	enc := json.NewEncoder(w)
+	nextID := 0
+	var write func(n *treeNode, parent int)
+	write = func(n *treeNode, parent int) {
+		id := nextID
+		nextID++
+		enc.Encode(ndjsonNode{
+			ID: id, Parent: parent,
+			Name: n.Name, FullName: n.FullName,
+			Cum: n.Cum, CumFmt: n.CumFormat, Percent: n.Percent,
+		})
+		if flusher != nil {
+			flusher.Flush()
+		}
+		for _, c := range n.Children {
+			write(c, id)
+		}
+	}
+	write(root, -1)
+}
+
+// flamegraphSVG serves the flame graph as a self-contained, interactive SVG.
+func (ui *webInterface) flamegraphSVG(w http.ResponseWriter, req *http.Request) {
+	rootNode, config, ok := ui.buildFlameGraphTree(w, req, req.URL.Query().Get("view"))
+	if !ok {
+		return // error already reported
+	}
+	writeFlameGraphSVG(w, rootNode, config, false)
+}
+
+// flamegraphSandwichData serves the caller/callee view for the function
+// named by the required ?focus=<func> parameter.
+func (ui *webInterface) flamegraphSandwichData(w http.ResponseWriter, req *http.Request) {
+	focus := req.URL.Query().Get("focus")
+	if focus == "" {
+		http.Error(w, "missing required parameter: focus=<func>", http.StatusBadRequest)
+		return
+	}
+
+	g, nodeMap, config, ok := ui.buildFlameGraph(w, req)
+	if !ok {
+		return // error already reported
+	}
+
+	var focusNodes []*graph.Node
+	for _, n := range g.Nodes {
+		if n.Info.Name == focus {
+			focusNodes = append(focusNodes, n)
+		}
+	}
+	if len(focusNodes) == 0 {
+		http.Error(w, "no function matches focus: "+focus, http.StatusNotFound)
+		return
+	}
+
+	data := sandwichData{
+		Mode:    "sandwich",
+		Focus:   focus,
+		Callers: mergeSandwichTree(focusNodes, nodeMap, config, func(n *graph.Node) map[*graph.Node]*graph.Edge { return n.In }),
+		Callees: mergeSandwichTree(focusNodes, nodeMap, config, func(n *graph.Node) map[*graph.Node]*graph.Edge { return n.Out }),
+	}
+
+	switch format := req.URL.Query().Get("format"); format {
+	case "", "json":
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(data); err != nil {
+			http.Error(w, "error serializing sandwich view", http.StatusInternalServerError)
+			ui.options.UI.PrintErr(err)
+		}
+	default:
+		http.Error(w, "format="+format+" is not supported for view=sandwich; use json", http.StatusBadRequest)
+	}
+}
+
+// mergeSandwichTree builds a tree rooted at a synthetic "focus" node,
+// recursing outward via edges and merging repeated functions into one node.
+func mergeSandwichTree(focusNodes []*graph.Node, nodeMap map[*graph.Node]*treeNode, config *graph.DotConfig, edges func(*graph.Node) map[*graph.Node]*graph.Edge) *treeNode {
+	var cum int64
+	byName := map[string]*treeNode{}
+	linkedChildren := map[*treeNode]map[string]bool{}
+	var walk func(n *graph.Node) *treeNode
+	walk = func(n *graph.Node) *treeNode {
+		src := nodeMap[n]
+		existing, seen := byName[src.FullName]
+		if !seen {
+			existing = &treeNode{
+				Name:      src.Name,
+				FullName:  src.FullName,
+				Cum:       0,
+				CumFormat: src.CumFormat,
+				Percent:   src.Percent,
+			}
+			byName[src.FullName] = existing
+			linkedChildren[existing] = map[string]bool{}
+		}
+		existing.Cum += n.CumValue()
+		existing.CumFormat = config.FormatValue(existing.Cum)
+		existing.Percent = strings.TrimSpace(measurement.Percentage(existing.Cum, config.Total))
+		for next := range edges(n) {
+			child := walk(next)
+			if !linkedChildren[existing][child.FullName] {
+				linkedChildren[existing][child.FullName] = true
+				existing.Children = append(existing.Children, child)
+			}
+		}
+		return existing
+	}
+
+	var roots []*treeNode
+	for _, fn := range focusNodes {
+		cum += fn.CumValue()
+		for next := range edges(fn) {
+			roots = append(roots, walk(next))
+		}
+	}
+
+	return &treeNode{
+		Name:      "focus",
+		FullName:  "focus",
+		Cum:       cum,
+		CumFormat: config.FormatValue(cum),
+		Percent:   strings.TrimSpace(measurement.Percentage(cum, config.Total)),
+		Children:  roots,
+	}
+}
+
+// buildFlameGraphTree generates the call tree for the flame (view=="") or
+// icicle (view=="icicle") orientation. It reports the error itself and
+// returns ok=false if the report could not be generated.
+func (ui *webInterface) buildFlameGraphTree(w http.ResponseWriter, req *http.Request, view string) (*treeNode, *graph.DotConfig, bool) {
+	g, config, ok := ui.buildFlameGraphGraph(w, req)
+	if !ok {
+		return nil, nil, false
+	}
+	return mergeFlameGraphTree(g, config, view == "icicle"), config, true
+}
+
+// mergeFlameGraphTree builds a tree rooted at a synthetic "root" node,
+// merging graph nodes that share a FullName (recursive or mutually
+// recursive functions reached via distinct paths) into a single tree node,
+// the same way mergeSandwichTree does for the sandwich view. Without this,
+// naively walking each graph node once and reusing its *treeNode for every
+// occurrence produces duplicated, unpartitioned Cum totals once the tree is
+// inverted for the icicle view. Children follow Out edges for the flame
+// orientation, or In edges (inverted) for the icicle orientation. It merges
+// directly off g rather than through an unmerged per-node *treeNode map, so
+// the flame/icicle/diff paths never hold both copies at once.
+func mergeFlameGraphTree(g *graph.Graph, config *graph.DotConfig, invert bool) *treeNode {
+	children := func(n *graph.Node) map[*graph.Node]*graph.Edge { return n.Out }
+	isRoot := func(n *graph.Node) bool { return len(n.In) == 0 }
+	if invert {
+		children = func(n *graph.Node) map[*graph.Node]*graph.Edge { return n.In }
+		isRoot = func(n *graph.Node) bool { return len(n.Out) == 0 }
+	}
+
+	byName := map[string]*treeNode{}
+	linkedChildren := map[*treeNode]map[string]bool{}
+	var walk func(n *graph.Node) *treeNode
+	walk = func(n *graph.Node) *treeNode {
+		fullName := n.Info.PrintableName()
+		existing, seen := byName[fullName]
+		if !seen {
+			existing = &treeNode{Name: graph.ShortenFunctionName(fullName), FullName: fullName}
+			byName[fullName] = existing
+			linkedChildren[existing] = map[string]bool{}
+		}
+		existing.Cum += n.CumValue()
+		existing.CumFormat = config.FormatValue(existing.Cum)
+		existing.Percent = strings.TrimSpace(measurement.Percentage(existing.Cum, config.Total))
+		for next := range children(n) {
+			child := walk(next)
+			if !linkedChildren[existing][child.FullName] {
+				linkedChildren[existing][child.FullName] = true
+				existing.Children = append(existing.Children, child)
+			}
+		}
+		return existing
+	}
+
+	root := &treeNode{Name: "root", FullName: "root"}
+	linkedChildren[root] = map[string]bool{}
+	var rootValue int64
+	for _, n := range g.Nodes {
+		if !isRoot(n) {
+			continue
+		}
+		rootValue += n.CumValue()
+		child := walk(n)
+		if !linkedChildren[root][child.FullName] {
+			linkedChildren[root][child.FullName] = true
+			root.Children = append(root.Children, child)
+		}
+	}
+	root.Cum = rootValue
+	root.CumFormat = config.FormatValue(rootValue)
+	root.Percent = strings.TrimSpace(measurement.Percentage(rootValue, config.Total))
+	return root
+}
+
+// buildFlameGraph generates the graph and per-node treeNode map needed by
+// the sandwich view, which merges by focus function rather than by root.
+func (ui *webInterface) buildFlameGraph(w http.ResponseWriter, req *http.Request) (*graph.Graph, map[*graph.Node]*treeNode, *graph.DotConfig, bool) {
+	g, config, ok := ui.buildFlameGraphGraph(w, req)
+	if !ok {
+		return nil, nil, nil, false
+	}
+	return g, nodeTreeMap(g, config), config, true
+}
+
+// buildFlameGraphGraph generates the call-tree report and dot graph for the
+// profile selected by req. It is shared by buildFlameGraph (sandwich view)
+// and buildFlameGraphTree, which merges straight off the graph instead of
+// through the unmerged per-node map, so the flame/icicle/diff paths never
+// hold both copies of the tree in memory at once.
+func (ui *webInterface) buildFlameGraphGraph(w http.ResponseWriter, req *http.Request) (*graph.Graph, *graph.DotConfig, bool) {
 	// Force the call tree so that the graph is a tree.
 	// Also do not trim the tree so that the flame graph contains all functions.
 	rpt, errList := ui.makeReport(w, req, []string{"svg"}, func(cfg *config) {
@@ -39,76 +346,214 @@ func (ui *webInterface) flamegraphData(w http.ResponseWriter, req *http.Request)
 	if rpt == nil {
 		ui.options.UI.PrintErr(errList)
 		http.Error(w, "error genereating report"+strings.Join(errList, ";"), http.StatusInternalServerError)
-		return
+		return nil, nil, false
 	}
 
 	// Generate dot graph.
 	g, config := report.GetDOT(rpt)
-	var nodes []*treeNode
-	nroots := 0
-	rootValue := int64(0)
-	nodeArr := []string{}
+	return g, config, true
+}
+
+// nodeTreeMap builds the unmerged per-node *treeNode for every node in g,
+// the starting point mergeSandwichTree merges down from.
+func nodeTreeMap(g *graph.Graph, config *graph.DotConfig) map[*graph.Node]*treeNode {
 	nodeMap := map[*graph.Node]*treeNode{}
-	// Make all nodes and the map, collect the roots.
 	for _, n := range g.Nodes {
 		v := n.CumValue()
 		fullName := n.Info.PrintableName()
-		node := &treeNode{
+		nodeMap[n] = &treeNode{
 			Name:      graph.ShortenFunctionName(fullName),
 			FullName:  fullName,
 			Cum:       v,
 			CumFormat: config.FormatValue(v),
 			Percent:   strings.TrimSpace(measurement.Percentage(v, config.Total)),
 		}
-		nodes = append(nodes, node)
-		if len(n.In) == 0 {
-			nodes[nroots], nodes[len(nodes)-1] = nodes[len(nodes)-1], nodes[nroots]
-			nroots++
-			rootValue += v
-		}
-		nodeMap[n] = node
-		// Get all node names into an array.
-		nodeArr = append(nodeArr, n.Info.Name)
 	}
-	// Populate the child links.
-	for _, n := range g.Nodes {
-		node := nodeMap[n]
-		for child := range n.Out {
-			node.Children = append(node.Children, nodeMap[child])
-		}
+	return nodeMap
+}
+
+// diffTreeNode is a treeNode augmented with the delta of Cum against a base
+// profile, for the differential flame graph.
+type diffTreeNode struct {
+	Name         string          `json:"n"`
+	FullName     string          `json:"f"`
+	Cum          int64           `json:"v"`
+	CumFormat    string          `json:"l"`
+	Percent      string          `json:"p"`
+	Delta        int64           `json:"d"`
+	DeltaFormat  string          `json:"df"`
+	DeltaPercent string          `json:"dp"`
+	Children     []*diffTreeNode `json:"c"`
+}
+
+// flamegraphDiffData serves a differential flame graph against the base
+// profile named by the required ?base=<profile-id-or-url> parameter.
+func (ui *webInterface) flamegraphDiffData(w http.ResponseWriter, req *http.Request) {
+	base := req.URL.Query().Get("base")
+	if base == "" {
+		http.Error(w, "missing required parameter: base=<profile-id-or-url>", http.StatusBadRequest)
+		return
 	}
 
-	rootNode := &treeNode{
-		Name:      "root",
-		FullName:  "root",
-		Cum:       rootValue,
-		CumFormat: config.FormatValue(rootValue),
-		Percent:   strings.TrimSpace(measurement.Percentage(rootValue, config.Total)),
-		Children:  nodes[0:nroots],
+	curNode, config, ok := ui.buildFlameGraphTree(w, req, "")
+	if !ok {
+		return // error already reported
+	}
+	baseNode, _, ok := ui.buildFlameGraphTreeFromSource(w, req, base)
+	if !ok {
+		return // error already reported
 	}
 
-	// JSON marshalling flame graph
+	diffNode := diffFlameGraphTree(curNode, baseNode, config)
 	w.Header().Add("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(rootNode); err != nil {
-		http.Error(w, "error serializing flame graph", http.StatusInternalServerError)
+	if err := json.NewEncoder(w).Encode(diffNode); err != nil {
+		http.Error(w, "error serializing flame graph diff", http.StatusInternalServerError)
 		ui.options.UI.PrintErr(err)
 	}
 }
 
-// dotsvg generates an svg diagram.
-func (ui *webInterface) dotsvg(w http.ResponseWriter, req *http.Request) {
+// buildFlameGraphTreeFromSource is buildFlameGraphTree for a profile fetched
+// from an arbitrary source rather than the profile bound to req.
+func (ui *webInterface) buildFlameGraphTreeFromSource(w http.ResponseWriter, req *http.Request, source string) (*treeNode, *graph.DotConfig, bool) {
+	prof, _, err := ui.options.Fetch.Fetch(source, 0, 0)
+	if err != nil {
+		http.Error(w, "error fetching base profile "+source+": "+err.Error(), http.StatusBadRequest)
+		ui.options.UI.PrintErr(err)
+		return nil, nil, false
+	}
+
+	cfg := currentConfig()
+	cfg.CallTree = true
+	cfg.Trim = false
+	_, rpt, err := generateRawReport(prof, []string{"svg"}, cfg, ui.options)
+	if err != nil {
+		http.Error(w, "error generating base report: "+err.Error(), http.StatusInternalServerError)
+		ui.options.UI.PrintErr(err)
+		return nil, nil, false
+	}
+
+	g, config := report.GetDOT(rpt)
+	return mergeFlameGraphTree(g, config, false), config, true
+}
+
+// diffFlameGraphTree merges cur and base by FullName at every level,
+// producing a diffTreeNode tree shaped like cur, with children found only
+// in base appended after cur's children as zero-Cum subtrees.
+func diffFlameGraphTree(cur, base *treeNode, config *graph.DotConfig) *diffTreeNode {
+	var baseCum int64
+	baseChildren := map[string]*treeNode{}
+	if base != nil {
+		baseCum = base.Cum
+		for _, c := range base.Children {
+			baseChildren[c.FullName] = c
+		}
+	}
+	delta := cur.Cum - baseCum
+
+	node := &diffTreeNode{
+		Name:         cur.Name,
+		FullName:     cur.FullName,
+		Cum:          cur.Cum,
+		CumFormat:    cur.CumFormat,
+		Percent:      cur.Percent,
+		Delta:        delta,
+		DeltaFormat:  formatDelta(delta, config),
+		DeltaPercent: deltaPercent(delta, config),
+	}
+	for _, c := range cur.Children {
+		node.Children = append(node.Children, diffFlameGraphTree(c, baseChildren[c.FullName], config))
+		delete(baseChildren, c.FullName)
+	}
+	// Anything left in baseChildren exists only in the base profile.
+	if base != nil {
+		for _, c := range base.Children {
+			if removed, ok := baseChildren[c.FullName]; ok {
+				node.Children = append(node.Children, baseOnlyDiffNode(removed, config))
+			}
+		}
+	}
+	return node
+}
+
+// baseOnlyDiffNode renders a subtree that exists only in the base profile.
+func baseOnlyDiffNode(base *treeNode, config *graph.DotConfig) *diffTreeNode {
+	delta := -base.Cum
+	node := &diffTreeNode{
+		Name:         base.Name,
+		FullName:     base.FullName,
+		Cum:          0,
+		CumFormat:    config.FormatValue(0),
+		Percent:      strings.TrimSpace(measurement.Percentage(0, config.Total)),
+		Delta:        delta,
+		DeltaFormat:  formatDelta(delta, config),
+		DeltaPercent: deltaPercent(delta, config),
+	}
+	for _, c := range base.Children {
+		node.Children = append(node.Children, baseOnlyDiffNode(c, config))
+	}
+	return node
+}
+
+// formatDelta formats a delta value with an explicit sign.
+func formatDelta(delta int64, config *graph.DotConfig) string {
+	if delta > 0 {
+		return "+" + config.FormatValue(delta)
+	}
+	return config.FormatValue(delta)
+}
+
+// deltaPercent computes the signed percent-of-total for a diff delta.
+// measurement.Percentage takes the absolute value internally, so the sign
+// lost there is reapplied here the same way formatDelta reapplies it.
+func deltaPercent(delta int64, config *graph.DotConfig) string {
+	pct := strings.TrimSpace(measurement.Percentage(delta, config.Total))
+	switch {
+	case delta > 0:
+		return "+" + pct
+	case delta < 0:
+		return "-" + pct
+	default:
+		return pct
+	}
+}
+
+// graphvizEngines is the allowlist of layout engines renderGraph accepts.
+var graphvizEngines = map[string]bool{
+	"dot": true, "neato": true, "twopi": true, "circo": true, "fdp": true, "sfdp": true,
+}
+
+// graphvizContentTypes are the output formats renderGraph knows how to label.
+var graphvizContentTypes = map[string]string{
+	"svg":   "image/svg+xml",
+	"png":   "image/png",
+	"pdf":   "application/pdf",
+	"json":  "application/json",
+	"cmapx": "text/html",
+}
+
+// composeDotGraph generates the dot-format call graph for the profile
+// selected by req, shared by dotsvg, dotgraph, renderGraph and dotData.
+func (ui *webInterface) composeDotGraph(w http.ResponseWriter, req *http.Request) (*bytes.Buffer, *graph.DotConfig, bool) {
 	rpt, errList := ui.makeReport(w, req, []string{"svg"}, nil)
 	if rpt == nil {
 		ui.options.UI.PrintErr(errList)
-		return // error already reported
+		return nil, nil, false // error already reported
 	}
 
-	// Generate dot graph.
 	g, config := report.GetDOT(rpt)
 	config.Labels = nil
 	dot := &bytes.Buffer{}
 	graph.ComposeDot(dot, g, &graph.DotAttributes{}, config)
+	return dot, config, true
+}
+
+// dotsvg generates an svg diagram.
+func (ui *webInterface) dotsvg(w http.ResponseWriter, req *http.Request) {
+	dot, _, ok := ui.composeDotGraph(w, req)
+	if !ok {
+		return // error already reported
+	}
 
 	// Convert to svg.
 	svg, err := dotToSvg(dot.Bytes())
@@ -124,19 +569,246 @@ func (ui *webInterface) dotsvg(w http.ResponseWriter, req *http.Request) {
 
 // dotgraph generates dot formated graph.
 func (ui *webInterface) dotgraph(w http.ResponseWriter, req *http.Request) {
-	rpt, errList := ui.makeReport(w, req, []string{"svg"}, nil)
-	if rpt == nil {
-		ui.options.UI.PrintErr(errList)
+	dot, _, ok := ui.composeDotGraph(w, req)
+	if !ok {
 		return // error already reported
 	}
 
-	// Generate dot graph.
-	g, config := report.GetDOT(rpt)
-	config.Labels = nil
-	dot := &bytes.Buffer{}
-	graph.ComposeDot(dot, g, &graph.DotAttributes{}, config)
-
 	w.Header().Add("Content-Type", "image/svg+xml")
 	w.WriteHeader(http.StatusOK)
 	w.Write(dot.Bytes())
 }
+
+// renderGraph generalizes dotsvg/dotgraph with ?engine=&format= selection.
+func (ui *webInterface) renderGraph(w http.ResponseWriter, req *http.Request) {
+	dot, _, ok := ui.composeDotGraph(w, req)
+	if !ok {
+		return // error already reported
+	}
+
+	engine := req.URL.Query().Get("engine")
+	if engine == "" {
+		engine = "dot"
+	}
+	if !graphvizEngines[engine] {
+		http.Error(w, "unknown graphviz engine: "+engine, http.StatusBadRequest)
+		return
+	}
+
+	format := req.URL.Query().Get("format")
+	if format == "" {
+		format = "svg"
+	}
+	if format == "dot" {
+		w.Header().Add("Content-Type", "text/vnd.graphviz")
+		w.WriteHeader(http.StatusOK)
+		w.Write(dot.Bytes())
+		return
+	}
+	contentType, ok := graphvizContentTypes[format]
+	if !ok {
+		http.Error(w, "unknown output format: "+format, http.StatusBadRequest)
+		return
+	}
+
+	// The default engine/format pair goes through dotToSvg, which patches
+	// around dot's habit of emitting unescaped ampersands; bypassing it via
+	// runGraphviz would reintroduce that bug for the common case.
+	var out []byte
+	var err error
+	if engine == "dot" && format == "svg" {
+		out, err = dotToSvg(dot.Bytes())
+	} else {
+		out, err = runGraphviz(engine, format, dot.Bytes())
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Could not execute %s; may need to install graphviz.", engine), http.StatusNotImplemented)
+		ui.options.UI.PrintErr(fmt.Sprintf("Failed to execute %s. Is Graphviz installed?\n", engine), err)
+		return
+	}
+	w.Header().Add("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(out)
+}
+
+// runGraphviz pipes dot through `engine -Tformat` and returns its stdout.
+func runGraphviz(engine, format string, dot []byte) ([]byte, error) {
+	cmd := exec.Command(engine, "-T"+format)
+	cmd.Stdin = bytes.NewReader(dot)
+	return cmd.Output()
+}
+
+// dotDataTotals is the subset of the dot config surfaced alongside the dot text.
+type dotDataTotals struct {
+	Total       int64  `json:"total"`
+	TotalFormat string `json:"totalFormat"`
+}
+
+// dotDataResponse is the ?format=json wrapper for dotData.
+type dotDataResponse struct {
+	Dot    string        `json:"dot"`
+	Totals dotDataTotals `json:"totals"`
+}
+
+// dotData returns the raw composed dot text as text/vnd.graphviz, or as a
+// {dot, totals} JSON wrapper with ?format=json.
+func (ui *webInterface) dotData(w http.ResponseWriter, req *http.Request) {
+	dot, config, ok := ui.composeDotGraph(w, req)
+	if !ok {
+		return // error already reported
+	}
+
+	if req.URL.Query().Get("format") == "json" {
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		resp := dotDataResponse{
+			Dot: dot.String(),
+			Totals: dotDataTotals{
+				Total:       config.Total,
+				TotalFormat: config.FormatValue(config.Total),
+			},
+		}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			http.Error(w, "error serializing dot graph", http.StatusInternalServerError)
+			ui.options.UI.PrintErr(err)
+		}
+		return
+	}
+
+	w.Header().Add("Content-Type", "text/vnd.graphviz")
+	w.WriteHeader(http.StatusOK)
+	w.Write(dot.Bytes())
+}
+
+// Layout constants for the server-rendered flame graph SVG.
+const (
+	flameGraphWidth     = 1200
+	flameGraphRowHeight = 16
+)
+
+// flameGraphRect is one laid-out rectangle of the flame graph.
+type flameGraphRect struct {
+	X, Y, W, H float64
+	Node       *treeNode
+}
+
+// layoutFlameGraph walks root top-down, sizing each node's width
+// proportionally to its Cum value within its parent's width.
+func layoutFlameGraph(root *treeNode) []flameGraphRect {
+	var rects []flameGraphRect
+	var walk func(n *treeNode, x, y, w float64)
+	walk = func(n *treeNode, x, y, w float64) {
+		rects = append(rects, flameGraphRect{X: x, Y: y, W: w, H: flameGraphRowHeight, Node: n})
+		if n.Cum == 0 || len(n.Children) == 0 {
+			return
+		}
+		childX := x
+		for _, c := range n.Children {
+			childW := w * float64(c.Cum) / float64(n.Cum)
+			walk(c, childX, y+flameGraphRowHeight, childW)
+			childX += childW
+		}
+	}
+	walk(root, 0, 0, flameGraphWidth)
+	return rects
+}
+
+// flameGraphDepth returns the number of rows needed to render root.
+func flameGraphDepth(root *treeNode) int {
+	depth := 1
+	var walk func(n *treeNode, d int)
+	walk = func(n *treeNode, d int) {
+		if d > depth {
+			depth = d
+		}
+		for _, c := range n.Children {
+			walk(c, d+1)
+		}
+	}
+	walk(root, 1)
+	return depth
+}
+
+// writeFlameGraphSVG renders root as a self-contained, interactive SVG,
+// wrapped in a minimal HTML document if asHTML is set.
+func writeFlameGraphSVG(w http.ResponseWriter, root *treeNode, config *graph.DotConfig, asHTML bool) {
+	rects := layoutFlameGraph(root)
+	height := float64(flameGraphDepth(root)) * flameGraphRowHeight
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="100%%" height="%d" font-family="sans-serif" font-size="10">`,
+		flameGraphWidth, int(height), int(height))
+	fmt.Fprintf(&buf, `<g id="frames">`)
+	for i, r := range rects {
+		fmt.Fprintf(&buf,
+			`<g class="frame" data-name="%s" data-root-x="%g" data-root-w="%g" transform="translate(%g,%g)">`+
+				`<rect width="%g" height="%g" fill="%s" stroke="white"/>`+
+				`<clipPath id="clip%d"><rect width="%g" height="%g"/></clipPath>`+
+				`<text x="2" y="%g" clip-path="url(#clip%d)">%s (%s)</text>`+
+				`</g>`,
+			html.EscapeString(r.Node.FullName), r.X, r.W, r.X, r.Y,
+			r.W, r.H, frameColor(r.Node.FullName),
+			i, r.W, r.H,
+			r.H-4, i, html.EscapeString(r.Node.Name), r.Node.Percent)
+	}
+	buf.WriteString(`</g>`)
+	buf.WriteString(flameGraphScript)
+	buf.WriteString(`</svg>`)
+
+	if asHTML {
+		w.Header().Add("Content-Type", "text/html")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `<!DOCTYPE html><html><head><title>Flame Graph</title></head><body>`+
+			`<input id="flamesearch" type="search" placeholder="search functions" style="width:%dpx"/>%s</body></html>`,
+			flameGraphWidth, buf.String())
+		return
+	}
+	w.Header().Add("Content-Type", "image/svg+xml")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// frameColor picks a stable, warm color for a frame based on its name.
+func frameColor(name string) string {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	n := h.Sum32()
+	r := 205 + n%50
+	g := 0 + (n>>8)%230
+	b := 0 + (n>>16)%20
+	return fmt.Sprintf("rgb(%d,%d,%d)", r, g, b)
+}
+
+// flameGraphScript implements click-to-zoom and search highlighting
+// directly in the SVG, so the document needs no external JS or CSS.
+const flameGraphScript = `<script><![CDATA[
+(function() {
+  var svg = document.currentScript.ownerSVGElement;
+  var frames = svg.querySelectorAll('.frame');
+  svg.addEventListener('click', function(e) {
+    var frame = e.target.closest ? e.target.closest('.frame') : null;
+    if (!frame) return;
+    var x = parseFloat(frame.getAttribute('data-root-x'));
+    var w = parseFloat(frame.getAttribute('data-root-w'));
+    if (!w) return;
+    var vb = svg.viewBox.baseVal;
+    svg.setAttribute('viewBox', x + ' ' + vb.y + ' ' + w + ' ' + vb.height);
+  });
+  svg.addEventListener('dblclick', function() {
+    svg.setAttribute('viewBox', svg.getAttribute('data-orig-viewbox'));
+  });
+  svg.setAttribute('data-orig-viewbox', svg.getAttribute('viewBox'));
+  var search = document.getElementById('flamesearch');
+  if (search) {
+    search.addEventListener('input', function() {
+      var term = search.value.toLowerCase();
+      frames.forEach(function(f) {
+        var rect = f.querySelector('rect');
+        var match = term.length > 0 && f.getAttribute('data-name').toLowerCase().indexOf(term) !== -1;
+        rect.setAttribute('stroke', match ? 'black' : 'white');
+        rect.setAttribute('stroke-width', match ? '2' : '1');
+      });
+    });
+  }
+})();
+]]></script>`
@@ -0,0 +1,173 @@
+package driver
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/internal/graph"
+)
+
+func tree(name string, cum int64, children ...*treeNode) *treeNode {
+	return &treeNode{Name: name, FullName: name, Cum: cum, Children: children}
+}
+
+func TestLayoutFlameGraph(t *testing.T) {
+	root := tree("root", 100,
+		tree("a", 75),
+		tree("b", 25),
+	)
+
+	rects := layoutFlameGraph(root)
+	if len(rects) != 3 {
+		t.Fatalf("got %d rects, want 3", len(rects))
+	}
+	if rects[0].Node != root || rects[0].X != 0 || rects[0].W != flameGraphWidth {
+		t.Errorf("root rect = %+v, want full width at x=0", rects[0])
+	}
+	if got, want := rects[1].W, flameGraphWidth*0.75; got != want {
+		t.Errorf("a width = %v, want %v", got, want)
+	}
+	if got, want := rects[2].X, rects[1].W; got != want {
+		t.Errorf("b x = %v, want %v (after a)", got, want)
+	}
+}
+
+func TestFlameGraphDepth(t *testing.T) {
+	root := tree("root", 1, tree("a", 1, tree("b", 1)))
+	if got, want := flameGraphDepth(root), 3; got != want {
+		t.Errorf("flameGraphDepth = %d, want %d", got, want)
+	}
+}
+
+func TestFrameColorStable(t *testing.T) {
+	c1 := frameColor("runtime.gopark")
+	c2 := frameColor("runtime.gopark")
+	if c1 != c2 {
+		t.Errorf("frameColor not stable: %q != %q", c1, c2)
+	}
+	if !strings.HasPrefix(c1, "rgb(") {
+		t.Errorf("frameColor = %q, want rgb(...)", c1)
+	}
+}
+
+func TestWriteFlameGraphSVG(t *testing.T) {
+	root := tree("root", 10, tree("a", 10))
+	w := httptest.NewRecorder()
+	writeFlameGraphSVG(w, root, nil, false)
+
+	if ct := w.Header().Get("Content-Type"); ct != "image/svg+xml" {
+		t.Errorf("Content-Type = %q, want image/svg+xml", ct)
+	}
+	body := w.Body.String()
+	if !strings.HasPrefix(body, "<svg") || !strings.HasSuffix(strings.TrimSpace(body), "</svg>") {
+		t.Errorf("body is not a single svg document: %q", body)
+	}
+	if !strings.Contains(body, `data-name="a"`) {
+		t.Errorf("body missing frame for child %q: %s", "a", body)
+	}
+}
+
+func TestWriteFlameGraphSVGHTML(t *testing.T) {
+	root := tree("root", 1)
+	w := httptest.NewRecorder()
+	writeFlameGraphSVG(w, root, nil, true)
+
+	if ct := w.Header().Get("Content-Type"); ct != "text/html" {
+		t.Errorf("Content-Type = %q, want text/html", ct)
+	}
+	if !strings.Contains(w.Body.String(), "<svg") {
+		t.Errorf("html wrapper missing embedded svg: %s", w.Body.String())
+	}
+}
+
+func testDotConfig(total int64) *graph.DotConfig {
+	return &graph.DotConfig{
+		Total:       total,
+		FormatValue: func(v int64) string { return fmt.Sprintf("%du", v) },
+	}
+}
+
+func TestFormatDelta(t *testing.T) {
+	config := testDotConfig(100)
+	if got, want := formatDelta(5, config), "+5u"; got != want {
+		t.Errorf("formatDelta(5) = %q, want %q", got, want)
+	}
+	if got, want := formatDelta(-5, config), "-5u"; got != want {
+		t.Errorf("formatDelta(-5) = %q, want %q", got, want)
+	}
+	if got, want := formatDelta(0, config), "0u"; got != want {
+		t.Errorf("formatDelta(0) = %q, want %q", got, want)
+	}
+}
+
+func TestDeltaPercentSign(t *testing.T) {
+	config := testDotConfig(100)
+	if got := deltaPercent(20, config); !strings.HasPrefix(got, "+") {
+		t.Errorf("deltaPercent(20) = %q, want a leading '+'", got)
+	}
+	if got := deltaPercent(-20, config); !strings.HasPrefix(got, "-") {
+		t.Errorf("deltaPercent(-20) = %q, want a leading '-'", got)
+	}
+	if got := deltaPercent(0, config); strings.HasPrefix(got, "+") || strings.HasPrefix(got, "-") {
+		t.Errorf("deltaPercent(0) = %q, want no sign", got)
+	}
+}
+
+func TestDiffFlameGraphTree(t *testing.T) {
+	config := testDotConfig(100)
+	cur := tree("root", 40, tree("a", 30), tree("new", 10))
+	base := tree("root", 60, tree("a", 50), tree("gone", 10))
+
+	diff := diffFlameGraphTree(cur, base, config)
+	if diff.Delta != -20 {
+		t.Errorf("root Delta = %d, want -20", diff.Delta)
+	}
+	if !strings.HasPrefix(diff.DeltaPercent, "-") {
+		t.Errorf("root DeltaPercent = %q, want a leading '-'", diff.DeltaPercent)
+	}
+
+	var names []string
+	for _, c := range diff.Children {
+		names = append(names, c.FullName)
+	}
+	if len(names) != 3 {
+		t.Fatalf("got children %v, want a, new and gone", names)
+	}
+}
+
+func TestBaseOnlyDiffNode(t *testing.T) {
+	config := testDotConfig(100)
+	base := tree("gone", 30, tree("gone-child", 30))
+
+	node := baseOnlyDiffNode(base, config)
+	if node.Cum != 0 || node.Delta != -30 {
+		t.Errorf("Cum, Delta = %d, %d, want 0, -30", node.Cum, node.Delta)
+	}
+	if !strings.HasPrefix(node.DeltaPercent, "-") {
+		t.Errorf("DeltaPercent = %q, want a leading '-'", node.DeltaPercent)
+	}
+	if len(node.Children) != 1 || node.Children[0].FullName != "gone-child" {
+		t.Errorf("Children = %+v, want one gone-child node", node.Children)
+	}
+}
+
+func TestWriteFlameGraphNDJSON(t *testing.T) {
+	root := tree("root", 3, tree("a", 2), tree("b", 1))
+	w := httptest.NewRecorder()
+	writeFlameGraphNDJSON(w, root)
+
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 3: %q", len(lines), w.Body.String())
+	}
+	if !strings.Contains(lines[0], `"parent":-1`) {
+		t.Errorf("root line missing parent:-1: %s", lines[0])
+	}
+	for _, line := range lines[1:] {
+		if !strings.Contains(line, `"parent":0`) {
+			t.Errorf("child line missing parent:0: %s", line)
+		}
+	}
+}